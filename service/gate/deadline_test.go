@@ -0,0 +1,72 @@
+package gate
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTcpBackendIdleTimeoutFiresWithoutReadTimeout is a regression test
+// for the idle-timeout fix: WithIdleTimeout alone (no WithReadTimeout)
+// must still kick a peer that never sends anything, since with
+// readTimeout == 0 SetReadDeadline is never called and ReadFrame blocks
+// forever -- the idle check inside isRetryable would never get a chance
+// to run without TcpBackend's own ticker-driven monitorIdle.
+func TestTcpBackendIdleTimeoutFiresWithoutReadTimeout(t *testing.T) {
+	g := &Gate{rwmutex: new(sync.RWMutex), sessions: make(map[uint32]Backend)}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	conf := NewConf("", 0, "").WithIdleTimeout(30 * time.Millisecond)
+	backend := newTcpBackend(1, serverConn, "", g, conf)
+	g.sessions[1] = backend
+
+	go backend.serve(g) // blocks in ReadFrame forever: no data, no ReadTimeout
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.rwmutex.RLock()
+		_, ok := g.sessions[1]
+		g.rwmutex.RUnlock()
+		if !ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("idle peer was never kicked despite WithIdleTimeout with no WithReadTimeout")
+}
+
+// TestTcpBackendIdleTimeoutDoesNotFireWhileFramesArrive checks the
+// companion path: a session that keeps sending frames within each idle
+// window must not be kicked.
+func TestTcpBackendIdleTimeoutDoesNotFireWhileFramesArrive(t *testing.T) {
+	g := &Gate{rwmutex: new(sync.RWMutex), sessions: make(map[uint32]Backend)}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	conf := NewConf("", 0, "").WithIdleTimeout(60 * time.Millisecond)
+	backend := newTcpBackend(1, serverConn, "", g, conf)
+	g.sessions[1] = backend
+	t.Cleanup(func() { g.kick(1) }) // goes through the map-guarded path, like production callers
+
+	go backend.serve(g)
+
+	f := Uint16BEFramer{MaxFrameSize: defaultMaxFrameSize}
+	w := bufio.NewWriter(clientConn)
+	stop := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(stop) {
+		if err := f.WriteFrame(w, []byte("x")); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	g.rwmutex.RLock()
+	_, ok := g.sessions[1]
+	g.rwmutex.RUnlock()
+	if !ok {
+		t.Fatal("session was kicked despite frames arriving within every idle window")
+	}
+}
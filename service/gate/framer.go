@@ -0,0 +1,241 @@
+package gate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrFrameTooLarge is returned by a Framer when a frame (or its declared
+// length prefix) exceeds the Framer's configured max frame size.
+var ErrFrameTooLarge = errors.New("gate: frame exceeds max frame size")
+
+// defaultMaxFrameSize bounds frame size for framers built by name when no
+// explicit size is given, so a hostile length header can't force a huge
+// allocation before the actual payload has even been read.
+const defaultMaxFrameSize = 1 << 20 // 1 MiB
+
+// Framer reads and writes one message frame at a time over a TcpBackend's
+// buffered connection, decoupling wire framing from the transport.
+// Implementations must validate any declared frame length against their
+// configured max size before allocating the frame buffer.
+type Framer interface {
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	WriteFrame(w *bufio.Writer, data []byte) error
+}
+
+// Names of the built-in framers, selectable via Conf.WithFramerName.
+const (
+	FramerUint16BE = "uint16be" // big-endian uint16 length prefix (default)
+	FramerUint32BE = "uint32be" // big-endian uint32 length prefix
+	FramerUint32LE = "uint32le" // little-endian uint32 length prefix
+	FramerVarint   = "varint"   // varint length prefix
+	FramerLine     = "line"     // newline-delimited
+)
+
+// namedFramer builds one of the built-in Framers by name, defaulting to
+// Uint16BEFramer (the original wire format) for an unknown or empty name.
+func namedFramer(name string, maxFrameSize uint32) Framer {
+	if maxFrameSize == 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	switch name {
+	case FramerUint32BE:
+		return Uint32BEFramer{maxFrameSize}
+	case FramerUint32LE:
+		return Uint32LEFramer{maxFrameSize}
+	case FramerVarint:
+		return VarintFramer{maxFrameSize}
+	case FramerLine:
+		return LineFramer{maxFrameSize}
+	default:
+		return Uint16BEFramer{maxFrameSize}
+	}
+}
+
+// readFrameBody validates length against maxFrameSize before allocating
+// the frame buffer, then reads it in full.
+func readFrameBody(r *bufio.Reader, length, maxFrameSize uint32) ([]byte, error) {
+	if length > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Uint16BEFramer is the original big-endian 2-byte length prefix framing,
+// capped at 64 KiB per frame by the header width itself.
+type Uint16BEFramer struct {
+	MaxFrameSize uint32
+}
+
+func (f Uint16BEFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	head := headerPool.Get().([]byte)
+	_, err := io.ReadFull(r, head)
+	length := binary.BigEndian.Uint16(head)
+	headerPool.Put(head)
+	if err != nil {
+		return nil, err
+	}
+	return readFrameBody(r, uint32(length), f.MaxFrameSize)
+}
+
+func (f Uint16BEFramer) WriteFrame(w *bufio.Writer, data []byte) error {
+	if len(data) > 0xFFFF || uint32(len(data)) > f.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	head := headerPool.Get().([]byte)
+	binary.BigEndian.PutUint16(head, uint16(len(data)))
+	_, err := w.Write(head)
+	headerPool.Put(head)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Uint32BEFramer is a big-endian 4-byte length prefix framing, for
+// payloads larger than Uint16BEFramer's 64 KiB ceiling allows.
+type Uint32BEFramer struct {
+	MaxFrameSize uint32
+}
+
+func (f Uint32BEFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	return readFrameBody(r, binary.BigEndian.Uint32(head), f.MaxFrameSize)
+}
+
+func (f Uint32BEFramer) WriteFrame(w *bufio.Writer, data []byte) error {
+	if uint32(len(data)) > f.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	head := make([]byte, 4)
+	binary.BigEndian.PutUint32(head, uint32(len(data)))
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Uint32LEFramer is a little-endian 4-byte length prefix framing, for
+// interop with peers that expect that byte order.
+type Uint32LEFramer struct {
+	MaxFrameSize uint32
+}
+
+func (f Uint32LEFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	return readFrameBody(r, binary.LittleEndian.Uint32(head), f.MaxFrameSize)
+}
+
+func (f Uint32LEFramer) WriteFrame(w *bufio.Writer, data []byte) error {
+	if uint32(len(data)) > f.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	head := make([]byte, 4)
+	binary.LittleEndian.PutUint32(head, uint32(len(data)))
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// VarintFramer prefixes each frame with its length as a protobuf-style
+// unsigned varint, keeping the header to one byte for small messages.
+type VarintFramer struct {
+	MaxFrameSize uint32
+}
+
+func (f VarintFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(f.MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+	return readFrameBody(r, uint32(length), f.MaxFrameSize)
+}
+
+func (f VarintFramer) WriteFrame(w *bufio.Writer, data []byte) error {
+	if uint32(len(data)) > f.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	head := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(head, uint64(len(data)))
+	if _, err := w.Write(head[:n]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// LineFramer delimits frames with a trailing '\n' (a leading '\r' is
+// also trimmed, so CRLF-terminated peers interoperate). MaxFrameSize
+// bounds line length so a peer that never sends '\n' can't grow the
+// bufio.Reader's internal buffer without limit.
+type LineFramer struct {
+	MaxFrameSize uint32
+}
+
+func (f LineFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	maxFrameSize := f.MaxFrameSize
+	if maxFrameSize == 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	// Read byte-by-byte rather than r.ReadBytes('\n'), which has no
+	// size bound of its own and would keep growing for a peer that
+	// never sends '\n'. Bailing out as soon as the line exceeds
+	// maxFrameSize caps memory use before the frame is ever returned.
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == '\n' {
+			break
+		}
+		if uint32(len(line)) >= maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		line = append(line, b)
+	}
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line, nil
+}
+
+func (f LineFramer) WriteFrame(w *bufio.Writer, data []byte) error {
+	if uint32(len(data)) > f.MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,74 @@
+package gate
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func allFramers(maxFrameSize uint32) map[string]Framer {
+	return map[string]Framer{
+		FramerUint16BE: Uint16BEFramer{maxFrameSize},
+		FramerUint32BE: Uint32BEFramer{maxFrameSize},
+		FramerUint32LE: Uint32LEFramer{maxFrameSize},
+		FramerVarint:   VarintFramer{maxFrameSize},
+		FramerLine:     LineFramer{maxFrameSize},
+	}
+}
+
+func TestFramerRoundTrip(t *testing.T) {
+	for name, f := range allFramers(1024) {
+		f := f
+		t.Run(name, func(t *testing.T) {
+			for _, msg := range [][]byte{[]byte(""), []byte("hello"), bytes.Repeat([]byte("x"), 512)} {
+				var buf bytes.Buffer
+				w := bufio.NewWriter(&buf)
+				if err := f.WriteFrame(w, msg); err != nil {
+					t.Fatalf("WriteFrame(%q): %v", msg, err)
+				}
+				got, err := f.ReadFrame(bufio.NewReader(&buf))
+				if err != nil {
+					t.Fatalf("ReadFrame after writing %q: %v", msg, err)
+				}
+				if !bytes.Equal(got, msg) {
+					t.Fatalf("round trip mismatch: wrote %q, read %q", msg, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFramerRejectsOversizeWrite(t *testing.T) {
+	for name, f := range allFramers(4) {
+		f := f
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			err := f.WriteFrame(w, []byte("too long"))
+			if err != ErrFrameTooLarge {
+				t.Fatalf("WriteFrame with oversize payload: got %v, want ErrFrameTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestLineFramerBoundsUnterminatedInput(t *testing.T) {
+	// A peer that never sends '\n' must not make ReadFrame buffer
+	// unbounded amounts of data before rejecting it.
+	f := LineFramer{MaxFrameSize: 4}
+	r := bufio.NewReader(bytes.NewReader(bytes.Repeat([]byte("x"), 1<<20)))
+	_, err := f.ReadFrame(r)
+	if err != ErrFrameTooLarge {
+		t.Fatalf("ReadFrame on unterminated oversize input: got %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestUint16BEFramerRejectsOversizeLength(t *testing.T) {
+	f := Uint16BEFramer{MaxFrameSize: 4}
+	var buf bytes.Buffer
+	buf.Write([]byte{0x00, 0x10}) // declares a 16-byte frame, over the 4-byte max
+	_, err := f.ReadFrame(bufio.NewReader(&buf))
+	if err != ErrFrameTooLarge {
+		t.Fatalf("ReadFrame with oversize declared length: got %v, want ErrFrameTooLarge", err)
+	}
+}
@@ -4,19 +4,33 @@ import (
 	"bufio"
 	"cham/cham"
 	"cham/service/log"
-	"encoding/binary"
+	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	OPEN uint8 = iota
 	KICK
+	CLOSE
 )
 
+// defaultWriteQueueSize is used when Conf.writeQueueSize is left at zero.
+const defaultWriteQueueSize = 256
+
+// defaultTLSHandshakeTimeout bounds how long a TLS handshake may take on
+// a newly accepted TCP connection, so a peer that never completes (or
+// deliberately drags out) the handshake only ties up its own goroutine.
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+var errWriteQueueFull = errors.New("gate: write queue full, session kicked")
+
 const (
 	OnOpen uint8 = iota
 	OnMessage
@@ -33,31 +47,204 @@ type Conf struct {
 	address   string //127.0.0.1:8000
 	maxclient uint32 // 0 -> no limit
 	path      string // "/ws" websocket, null is tcp
+	tlsConfig *tls.Config
+
+	// writeQueueSize bounds the number of outbound frames a TcpBackend
+	// will buffer before dropping frames and kicking the session.
+	// 0 -> defaultWriteQueueSize.
+	writeQueueSize uint32
+
+	// framer selects the TcpBackend wire framing. Left nil, it defaults
+	// to Uint16BEFramer (the original big-endian 2-byte length prefix).
+	framer Framer
+
+	// protocol is "" for NewConf's path-selected tcp/ws, or "kcp" when
+	// built via NewKcpConf.
+	protocol string
+
+	// heartbeat is the idle timeout for a kcp session; 0 -> defaultKcpHeartbeat.
+	heartbeat time.Duration
+
+	// readTimeout/writeTimeout bound a single framed read/write on a
+	// TcpBackend (and, via embedding, a KcpBackend); 0 -> no deadline.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// idleTimeout is the longest a TcpBackend/KcpBackend may go without
+	// a successfully read frame (or a WebsocketBackend without an
+	// answered ping) before being kicked; 0 -> no idle timeout.
+	idleTimeout time.Duration
 }
 
 func NewConf(address string, maxclient uint32, path string) *Conf {
-	return &Conf{address, maxclient, path}
+	return &Conf{address: address, maxclient: maxclient, path: path}
+}
+
+// NewKcpConf builds a Conf for a KCP (reliable, ordered, UDP-based) gate
+// listener. heartbeat bounds how long a session may stay idle before
+// being kicked (0 -> defaultKcpHeartbeat), since UDP gives no
+// transport-level signal that a peer has gone away.
+func NewKcpConf(address string, maxclient uint32, heartbeat time.Duration) *Conf {
+	return &Conf{address: address, maxclient: maxclient, protocol: "kcp", heartbeat: heartbeat}
+}
+
+// WithTLS enables TLS termination on the listener created from this Conf.
+// Set tlsConfig.ClientAuth (e.g. tls.RequireAndVerifyClientCert) to also
+// require and verify client certificates (mTLS).
+func (c *Conf) WithTLS(tlsConfig *tls.Config) *Conf {
+	c.tlsConfig = tlsConfig
+	return c
+}
+
+// WithWriteQueueSize sets the bounded outbound queue depth for TcpBackend
+// sessions created from this Conf.
+func (c *Conf) WithWriteQueueSize(n uint32) *Conf {
+	c.writeQueueSize = n
+	return c
+}
+
+// WithFramer installs a custom Framer, overriding the default
+// Uint16BEFramer used by TcpBackend to read and write frames.
+func (c *Conf) WithFramer(f Framer) *Conf {
+	c.framer = f
+	return c
+}
+
+// WithFramerName selects one of the built-in framers (FramerUint16BE,
+// FramerUint32BE, FramerUint32LE, FramerVarint, FramerLine) with the
+// given max frame size (0 -> defaultMaxFrameSize).
+func (c *Conf) WithFramerName(name string, maxFrameSize uint32) *Conf {
+	c.framer = namedFramer(name, maxFrameSize)
+	return c
+}
+
+// WithReadTimeout bounds how long a single framed read may take on a
+// TcpBackend/KcpBackend before it counts as a retryable timeout. 0
+// (the default) applies no deadline.
+func (c *Conf) WithReadTimeout(d time.Duration) *Conf {
+	c.readTimeout = d
+	return c
+}
+
+// WithWriteTimeout bounds how long a single framed write may take. 0
+// (the default) applies no deadline.
+func (c *Conf) WithWriteTimeout(d time.Duration) *Conf {
+	c.writeTimeout = d
+	return c
+}
+
+// WithIdleTimeout bounds how long a session may go without a
+// successfully read frame (TcpBackend/KcpBackend) or an answered ping
+// (WebsocketBackend) before it is kicked. 0 (the default) disables
+// idle kicking.
+func (c *Conf) WithIdleTimeout(d time.Duration) *Conf {
+	c.idleTimeout = d
+	return c
+}
+
+// resolveFramer returns the Conf's configured Framer, or the default
+// Uint16BEFramer if none was set.
+func (c *Conf) resolveFramer() Framer {
+	if c.framer != nil {
+		return c.framer
+	}
+	return namedFramer(FramerUint16BE, defaultMaxFrameSize)
 }
 
 type Gate struct {
-	rwmutex   *sync.RWMutex
-	Source    cham.Address
-	service   *cham.Service
-	session   uint32
-	clinetnum uint32
-	maxclient uint32
-	sessions  map[uint32]Backend
+	rwmutex       *sync.RWMutex
+	Source        cham.Address
+	service       *cham.Service
+	session       uint32
+	clinetnum     uint32
+	maxclient     uint32
+	sessions      map[uint32]Backend
+	droppedFrames uint64 // atomic
+
+	// listener is the tcp or kcp listener opened by this Gate, if any;
+	// httpServer is the websocket listener's *http.Server, if any.
+	// Shutdown closes whichever is set to stop accepting new sessions.
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// GateStats is a point-in-time snapshot of a Gate's outbound backpressure.
+type GateStats struct {
+	Sessions      uint32
+	QueueDepth    int
+	DroppedFrames uint64
+}
+
+// outboundLener is implemented by any Backend with a bounded outbound
+// queue whose depth Stats can report. TcpBackend implements it directly;
+// KcpBackend gets it for free through its embedded *TcpBackend.
+type outboundLener interface {
+	OutboundLen() int
+}
+
+// Stats reports the current session count, summed outbound queue depth
+// across all sessions backed by a bounded outbound queue (TcpBackend and
+// KcpBackend), and the cumulative number of frames dropped because a
+// session's outbound queue overflowed.
+func (g *Gate) Stats() GateStats {
+	g.rwmutex.RLock()
+	stats := GateStats{Sessions: uint32(len(g.sessions))}
+	for _, b := range g.sessions {
+		if t, ok := b.(outboundLener); ok {
+			stats.QueueDepth += t.OutboundLen()
+		}
+	}
+	g.rwmutex.RUnlock()
+	stats.DroppedFrames = atomic.LoadUint64(&g.droppedFrames)
+	return stats
 }
 
 type Backend interface {
 	Write(data []byte) error
 	Close()
+	// PeerInfo returns the authenticated peer identity (the TLS peer
+	// certificate subject) for this session, or "" if the connection
+	// is plaintext or no client certificate was presented.
+	PeerInfo() string
+	// Drain notifies the peer that the session is closing (a close
+	// frame, where the transport has one) and blocks until any
+	// in-flight writes have flushed or ctx is done. It does not tear
+	// the connection down; the caller still calls Close afterwards.
+	Drain(ctx context.Context)
+}
+
+// peerSubject extracts the subject of the first verified client
+// certificate from a TLS connection state, if any.
+func peerSubject(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.String()
 }
 
 type TcpBackend struct {
-	session uint32
-	conn    net.Conn
-	brw     *bufio.ReadWriter
+	session  uint32
+	conn     net.Conn
+	brw      *bufio.ReadWriter
+	peerInfo string
+	framer   Framer
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	lastRead     int64 // unix nano, atomic
+
+	gate     *Gate
+	outbound chan []byte
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// headerPool recycles the 2-byte frame length headers that
+// Uint16BEFramer reads and writes, shared across every TcpBackend using
+// that framer. The other framers allocate their own headers.
+var headerPool = sync.Pool{
+	New: func() interface{} { return make([]byte, 2) },
 }
 
 // tcp readbuf start
@@ -89,55 +276,188 @@ func putBufioWriter(w *bufio.Writer) {
 	bufioWriterPool.Put(w)
 }
 
-func newTcpBackend(session uint32, conn net.Conn) *TcpBackend {
+func newTcpBackend(session uint32, conn net.Conn, peerInfo string, gate *Gate, conf *Conf) *TcpBackend {
+	writeQueueSize := conf.writeQueueSize
+	if writeQueueSize == 0 {
+		writeQueueSize = defaultWriteQueueSize
+	}
 	br := newBufioReader(conn)
 	bw := newBufioWriter(conn)
-	return &TcpBackend{session, conn, bufio.NewReadWriter(br, bw)}
+	t := &TcpBackend{
+		session:      session,
+		conn:         conn,
+		brw:          bufio.NewReadWriter(br, bw),
+		peerInfo:     peerInfo,
+		framer:       conf.resolveFramer(),
+		readTimeout:  conf.readTimeout,
+		writeTimeout: conf.writeTimeout,
+		idleTimeout:  conf.idleTimeout,
+		gate:         gate,
+		outbound:     make(chan []byte, writeQueueSize),
+		done:         make(chan struct{}),
+	}
+	t.touch()
+	t.wg.Add(1)
+	go t.writeLoop()
+	if t.idleTimeout > 0 {
+		t.wg.Add(1)
+		go t.monitorIdle()
+	}
+	return t
 }
 
-// tcp readbuf end
+func (t *TcpBackend) touch() {
+	atomic.StoreInt64(&t.lastRead, time.Now().UnixNano())
+}
 
-func (t *TcpBackend) Close() {
-	putBufioReader(t.brw.Reader)
-	putBufioWriter(t.brw.Writer)
-	t.conn.Close()
+// monitorIdle kicks the session once it has gone longer than idleTimeout
+// without a successfully read frame. It runs off its own ticker rather
+// than piggybacking on the read deadline, since readTimeout (and so the
+// retry loop in readNextFrame) may be left at zero -- in which case a
+// silent peer would otherwise block in ReadFrame forever and the idle
+// check in isRetryable would never get a chance to run.
+func (t *TcpBackend) monitorIdle() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&t.lastRead))) > t.idleTimeout {
+				go t.gate.kick(t.session)
+				return
+			}
+		case <-t.done:
+			return
+		}
+	}
 }
 
-func (t *TcpBackend) Write(data []byte) (err error) {
-	head := make([]byte, 2)
-	binary.BigEndian.PutUint16(head, uint16(len(data)))
-	_, err = t.brw.Write(head)
-	if err == nil {
-		_, err = t.brw.Write(data)
+// isRetryable reports whether err is a transient, recoverable read
+// error (a per-read deadline firing) that hasn't yet pushed the
+// session past its overall idle timeout. Anything else -- a real
+// connection error, an error type we can't classify, or a deadline
+// that fires after the idle timeout has elapsed -- is not retryable.
+func (t *TcpBackend) isRetryable(err error) bool {
+	e, ok := err.(net.Error)
+	if !ok || !e.Temporary() {
+		return false
+	}
+	if t.idleTimeout > 0 && time.Since(time.Unix(0, atomic.LoadInt64(&t.lastRead))) > t.idleTimeout {
+		return false
+	}
+	return true
+}
+
+// readNextFrame reads the next frame, applying the configured read
+// deadline and retrying on transient timeouts until either a frame
+// arrives or a non-retryable (or idle-timeout-exceeded) error occurs.
+func (t *TcpBackend) readNextFrame() ([]byte, error) {
+	for {
+		if t.readTimeout > 0 {
+			t.conn.SetReadDeadline(time.Now().Add(t.readTimeout))
+		}
+		data, err := t.framer.ReadFrame(t.brw.Reader)
 		if err == nil {
-			err = t.brw.Flush()
+			t.touch()
+			return data, nil
+		}
+		if !t.isRetryable(err) {
+			return nil, err
 		}
 	}
-	return
 }
 
-func (t *TcpBackend) readFull(buf []byte) error {
-	if _, err := io.ReadFull(t.brw, buf); err != nil {
-		if e, ok := err.(net.Error); ok && !e.Temporary() {
-			return err
+// writeLoop drains the outbound queue and performs the actual framed
+// network write, so Gate.Write (and TcpBackend.Write) never block on I/O.
+func (t *TcpBackend) writeLoop() {
+	defer t.wg.Done()
+	for {
+		select {
+		case data := <-t.outbound:
+			if t.writeTimeout > 0 {
+				t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+			}
+			if err := t.framer.WriteFrame(t.brw.Writer, data); err != nil {
+				go t.gate.kick(t.session)
+				return
+			}
+		case <-t.done:
+			return
 		}
 	}
-	return nil
 }
 
-// bigendian 2byte length+data
-func (t *TcpBackend) serve(g *Gate) {
-	head := make([]byte, 2)
-	for {
-		if err := t.readFull(head); err != nil {
-			g.kick(t.session)
+// tcp readbuf end
+
+func (t *TcpBackend) PeerInfo() string {
+	return t.peerInfo
+}
+
+// OutboundLen reports the number of frames currently queued for the
+// writer goroutine, for Gate.Stats.
+func (t *TcpBackend) OutboundLen() int {
+	return len(t.outbound)
+}
+
+func (t *TcpBackend) Close() {
+	close(t.done)
+	// Close the connection before waiting on writeLoop: without a
+	// WriteTimeout, a stalled peer leaves writeLoop blocked in a plain
+	// syscall write that never observes t.done, so conn.Close (which
+	// unblocks it with an error) must happen first or wg.Wait hangs
+	// forever.
+	t.conn.Close()
+	t.wg.Wait()
+	// brw.Reader is returned to the pool by serve itself, once it
+	// actually stops reading (see serve) -- not here, since serve runs
+	// on its own goroutine outside t.wg and may still be using it for a
+	// moment after conn.Close unblocks it.
+	putBufioWriter(t.brw.Writer)
+}
+
+// Drain sends a zero-length frame as a best-effort close notice (this
+// framing has no dedicated close opcode) and waits for the outbound
+// queue to empty, so frames already accepted by Write aren't lost when
+// Close tears the connection down right after.
+func (t *TcpBackend) Drain(ctx context.Context) {
+	t.Write(nil)
+	for len(t.outbound) > 0 {
+		select {
+		case <-ctx.Done():
 			return
+		case <-time.After(10 * time.Millisecond):
 		}
+	}
+}
 
-		length := binary.BigEndian.Uint16(head)
-		data := make([]byte, length, length)
+// Write enqueues data on the backend's bounded outbound queue; the
+// writer goroutine performs the actual framed network write. If the
+// queue is full (a slow or stalled peer), the frame is dropped and the
+// session is kicked rather than letting the queue grow unbounded.
+func (t *TcpBackend) Write(data []byte) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	select {
+	case t.outbound <- buf:
+		return nil
+	default:
+		atomic.AddUint64(&t.gate.droppedFrames, 1)
+		go t.gate.kick(t.session)
+		return errWriteQueueFull
+	}
+}
 
-		if err := t.readFull(data); err != nil {
+// serve reads frames off the connection using the backend's configured
+// Framer until the peer disconnects or sends something the Framer
+// rejects (e.g. a frame over the configured max size). It owns
+// returning brw.Reader to the pool, since it's the only goroutine that
+// ever reads from it.
+func (t *TcpBackend) serve(g *Gate) {
+	defer putBufioReader(t.brw.Reader)
+	for {
+		data, err := t.readNextFrame()
+		if err != nil {
 			g.kick(t.session)
 			return
 		}
@@ -147,25 +467,70 @@ func (t *TcpBackend) serve(g *Gate) {
 
 type WebsocketBackend struct {
 	*Websocket
+	peerInfo  string
+	closeOnce sync.Once
+	lastPong  int64 // unix nano, atomic
+}
+
+func (w *WebsocketBackend) touch() {
+	atomic.StoreInt64(&w.lastPong, time.Now().UnixNano())
 }
 
 func (w *WebsocketBackend) Close() {
-	w.Websocket.Close(0, []byte(""))
+	w.closeOnce.Do(func() {
+		w.Websocket.Close(0, []byte(""))
+	})
+}
+
+// monitorHeartbeat pings the peer at half the idle timeout and kicks the
+// session if no OnPong has landed within a full idle window, since a
+// dead WebSocket peer otherwise leaves the connection open indefinitely.
+func (w *WebsocketBackend) monitorHeartbeat(g *Gate, idleTimeout time.Duration) {
+	ticker := time.NewTicker(idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.rwmutex.RLock()
+		b, ok := g.sessions[w.session]
+		g.rwmutex.RUnlock()
+		if !ok || b.(*WebsocketBackend) != w {
+			return
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&w.lastPong))) > idleTimeout {
+			g.kick(w.session)
+			return
+		}
+		w.Ping([]byte(""))
+	}
+}
+
+// Drain sends a real WebSocket close frame (status 1001, "going away")
+// immediately; there is no separate outbound queue to wait on here. A
+// subsequent Close is a no-op since the two share closeOnce.
+func (w *WebsocketBackend) Drain(ctx context.Context) {
+	w.closeOnce.Do(func() {
+		w.Websocket.Close(1001, []byte("gate shutting down"))
+	})
 }
 
 func (w *WebsocketBackend) Write(data []byte) error {
 	return w.SendText(data)
 }
 
+func (w *WebsocketBackend) PeerInfo() string {
+	return w.peerInfo
+}
+
 func newWebsocket(w http.ResponseWriter, r *http.Request, opt *Option, session uint32, gate *Gate) (*WebsocketBackend, error) {
 	ws, err := NewWebsocket(w, r, opt, session, gate)
 	if err != nil {
 		return nil, err
 	}
-	return &WebsocketBackend{ws}, nil
+	backend := &WebsocketBackend{Websocket: ws, peerInfo: peerSubject(r.TLS)}
+	backend.touch()
+	return backend, nil
 }
 
-//websocket start
+// websocket start
 type wsHandler struct {
 }
 
@@ -174,7 +539,13 @@ func (wd wsHandler) CheckOrigin(origin, host string) bool {
 }
 
 func (wd wsHandler) OnOpen(ws *Websocket) {
-	ws.gate.service.Notify(ws.gate.Source, cham.PTYPE_CLIENT, ws.session, OnOpen)
+	peerInfo := ""
+	ws.gate.rwmutex.RLock()
+	if b, ok := ws.gate.sessions[ws.session]; ok {
+		peerInfo = b.PeerInfo()
+	}
+	ws.gate.rwmutex.RUnlock()
+	ws.gate.service.Notify(ws.gate.Source, cham.PTYPE_CLIENT, ws.session, OnOpen, peerInfo)
 }
 
 func (wd wsHandler) OnMessage(ws *Websocket, message []byte) {
@@ -186,6 +557,13 @@ func (wd wsHandler) OnClose(ws *Websocket, code uint16, reason []byte) {
 }
 
 func (wd wsHandler) OnPong(ws *Websocket, data []byte) {
+	ws.gate.rwmutex.RLock()
+	if b, ok := ws.gate.sessions[ws.session]; ok {
+		if wb, ok := b.(*WebsocketBackend); ok {
+			wb.touch()
+		}
+	}
+	ws.gate.rwmutex.RUnlock()
 	ws.gate.service.Notify(ws.gate.Source, cham.PTYPE_CLIENT, ws.session, OnPong, data)
 }
 
@@ -206,60 +584,117 @@ func (g *Gate) nextSession() uint32 {
 	return atomic.AddUint32(&g.session, 1)
 }
 
-func (g *Gate) addBackend(session uint32, b Backend) {
+// addSession registers a newly-accepted backend under session, enforcing
+// maxclient and incrementing clinetnum atomically with the map insert.
+// It reports whether the session was admitted; on false the caller owns
+// closing the backend.
+func (g *Gate) addSession(session uint32, b Backend) bool {
 	g.rwmutex.Lock()
+	defer g.rwmutex.Unlock()
+	if g.maxclient != 0 && g.clinetnum >= g.maxclient {
+		return false
+	}
 	g.sessions[session] = b
-	g.rwmutex.Unlock()
+	g.clinetnum++
+	return true
 }
 
-//gate listen
+// gate listen
 func (g *Gate) open(conf *Conf) {
 	maxclient := conf.maxclient
 	g.maxclient = maxclient
-	if conf.path == "" {
-		log.Infoln("Tcp Gate start, listen ", conf.address)
-		listen, err := net.Listen("tcp", conf.address)
-		if err != nil {
-			panic("gate http open error:" + err.Error())
-		}
-		go func() {
-			defer listen.Close()
-			for {
-				conn, err := listen.Accept()
-				if err != nil {
-					continue
-				}
-				if maxclient != 0 && g.clinetnum >= maxclient {
-					conn.Close() //server close socket(!net.Error)
-					break
-				}
-				g.clinetnum++
-				session := g.nextSession()
-				backend := newTcpBackend(session, conn)
-				g.sessions[session] = backend // not need mutex, so not addBackend
-				go backend.serve(g)
-			}
-		}()
+	switch {
+	case conf.protocol == "kcp":
+		g.openKcp(conf)
+	case conf.path == "":
+		g.openTcp(conf)
+	default:
+		g.openWebsocket(conf)
+	}
+}
 
+func (g *Gate) openTcp(conf *Conf) {
+	log.Infoln("Tcp Gate start, listen ", conf.address)
+	var listen net.Listener
+	var err error
+	if conf.tlsConfig != nil {
+		listen, err = tls.Listen("tcp", conf.address, conf.tlsConfig)
 	} else {
-		log.Infoln("Websocket Gate start, listen ", conf.address)
-		var opt = Option{wsHandler{}, false}
-		http.HandleFunc(conf.path, func(w http.ResponseWriter, r *http.Request) {
-
-			if maxclient != 0 && g.clinetnum >= maxclient {
-				return
-			}
-			session := g.nextSession()
-			ws, err := newWebsocket(w, r, &opt, session, g)
+		listen, err = net.Listen("tcp", conf.address)
+	}
+	if err != nil {
+		panic("gate http open error:" + err.Error())
+	}
+	g.listener = listen
+	go func() {
+		defer listen.Close()
+		for {
+			conn, err := listen.Accept()
 			if err != nil {
-				return
+				return // listener closed (Shutdown) or otherwise unusable
 			}
-			g.addBackend(session, ws)
-			g.clinetnum++
-			ws.Start()
-		})
-		go func() { http.ListenAndServe(conf.address, nil) }()
+			// Handshake (when TLS) and session setup happen off the
+			// accept goroutine: a slow or hostile peer stalling the
+			// handshake must not block Accept from admitting anyone
+			// else.
+			go g.acceptTcp(conn, conf)
+		}
+	}()
+}
+
+// acceptTcp completes the TLS handshake (if any) and hands the
+// connection off to a new TcpBackend. It runs per-connection so a
+// stalling peer only ever blocks its own goroutine.
+func (g *Gate) acceptTcp(conn net.Conn, conf *Conf) {
+	peerInfo := ""
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn.SetDeadline(time.Now().Add(defaultTLSHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetDeadline(time.Time{})
+		state := tlsConn.ConnectionState()
+		peerInfo = peerSubject(&state)
+	}
+	session := g.nextSession()
+	backend := newTcpBackend(session, conn, peerInfo, g, conf)
+	if !g.addSession(session, backend) {
+		backend.Close() //server close socket(!net.Error)
+		return
 	}
+	g.service.Notify(g.Source, cham.PTYPE_CLIENT, session, OnOpen, backend.PeerInfo())
+	backend.serve(g)
+}
+
+func (g *Gate) openWebsocket(conf *Conf) {
+	log.Infoln("Websocket Gate start, listen ", conf.address)
+	var opt = Option{wsHandler{}, false}
+	http.HandleFunc(conf.path, func(w http.ResponseWriter, r *http.Request) {
+
+		session := g.nextSession()
+		ws, err := newWebsocket(w, r, &opt, session, g)
+		if err != nil {
+			return
+		}
+		if !g.addSession(session, ws) {
+			ws.Close()
+			return
+		}
+		if conf.idleTimeout > 0 {
+			go ws.monitorHeartbeat(g, conf.idleTimeout)
+		}
+		ws.Start()
+	})
+	server := &http.Server{Addr: conf.address, TLSConfig: conf.tlsConfig}
+	g.httpServer = server
+	go func() {
+		if conf.tlsConfig != nil {
+			server.ListenAndServeTLS("", "")
+		} else {
+			server.ListenAndServe()
+		}
+	}()
 }
 
 func (g *Gate) kick(session uint32) {
@@ -286,6 +721,83 @@ func (g *Gate) Write(session uint32, data []byte) (err error) {
 	return
 }
 
+// Shutdown stops accepting new sessions, asks every live session to
+// drain (sending a close frame and waiting for queued writes to
+// flush), then force-closes every remaining session as soon as draining
+// has finished or ctx is done, whichever comes first, waiting for those
+// closes at most until ctx is done. It returns ctx.Err(), which is
+// non-nil whenever ctx was done before draining and closing finished.
+func (g *Gate) Shutdown(ctx context.Context) error {
+	if g.listener != nil {
+		g.listener.Close()
+	}
+	if g.httpServer != nil {
+		g.httpServer.Close()
+	}
+
+	g.rwmutex.RLock()
+	sessions := make([]Backend, 0, len(g.sessions))
+	for _, b := range g.sessions {
+		sessions = append(sessions, b)
+	}
+	g.rwmutex.RUnlock()
+
+	drained := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(len(sessions))
+		for _, b := range sessions {
+			b := b
+			go func() {
+				defer wg.Done()
+				b.Drain(ctx)
+			}()
+		}
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	g.rwmutex.Lock()
+	remaining := make([]Backend, 0, len(g.sessions))
+	for session, b := range g.sessions {
+		remaining = append(remaining, b)
+		delete(g.sessions, session)
+	}
+	g.clinetnum = 0
+	g.rwmutex.Unlock()
+
+	// Force-close concurrently and bound the wait by ctx too: a single
+	// slow backend must not be able to make Shutdown block past the
+	// caller's deadline, even though Close should no longer hang on its
+	// own (see TcpBackend.Close).
+	closed := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		wg.Add(len(remaining))
+		for _, b := range remaining {
+			b := b
+			go func() {
+				defer wg.Done()
+				b.Close()
+			}()
+		}
+		wg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-ctx.Done():
+	}
+
+	return ctx.Err()
+}
+
 func ResponseStart(service *cham.Service, args ...interface{}) cham.Dispatch {
 	gate := args[0].(*Gate)
 	return func(session int32, source cham.Address, ptype uint8, args ...interface{}) []interface{} {
@@ -309,6 +821,9 @@ func Start(service *cham.Service, args ...interface{}) cham.Dispatch {
 			gate.open(args[1].(*Conf))
 		case KICK:
 			gate.kick(args[1].(uint32))
+		case CLOSE:
+			err := gate.Shutdown(args[1].(context.Context))
+			return cham.Ret(err)
 		}
 
 		return result
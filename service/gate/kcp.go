@@ -0,0 +1,87 @@
+package gate
+
+import (
+	"cham/cham"
+	"cham/service/log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	kcp "github.com/xtaci/kcp-go/v5"
+)
+
+// defaultKcpHeartbeat is the idle timeout applied to a KCP session when
+// Conf.heartbeat is left at zero: if no frame arrives for this long the
+// session is kicked, since UDP gives no transport-level disconnect
+// signal to rely on the way a TCP RST or FIN does.
+const defaultKcpHeartbeat = 30 * time.Second
+
+// KcpBackend is a Backend over a KCP (reliable, ordered, UDP-based)
+// session. It reuses TcpBackend's framing, outbound queue, backpressure
+// and read-deadline handling as-is, since *kcp.UDPSession satisfies
+// net.Conn, and layers a wall-clock heartbeat monitor on top -- a
+// backstop that kicks a quiet session even if Conf leaves readTimeout
+// unset (so readNextFrame would otherwise just block forever).
+type KcpBackend struct {
+	*TcpBackend
+	heartbeat time.Duration
+}
+
+func newKcpBackend(session uint32, conn net.Conn, gate *Gate, conf *Conf) *KcpBackend {
+	heartbeat := conf.heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultKcpHeartbeat
+	}
+	return &KcpBackend{
+		TcpBackend: newTcpBackend(session, conn, "", gate, conf),
+		heartbeat:  heartbeat,
+	}
+}
+
+// monitorHeartbeat kicks the session once it has gone longer than its
+// configured heartbeat without a successfully read frame, and exits
+// once the session is no longer registered with the gate (kicked via
+// either path, or a read error in serve).
+func (k *KcpBackend) monitorHeartbeat(g *Gate) {
+	ticker := time.NewTicker(k.heartbeat / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.rwmutex.RLock()
+		b, ok := g.sessions[k.session]
+		g.rwmutex.RUnlock()
+		if !ok || b.(*KcpBackend) != k {
+			return
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&k.lastRead))) > k.heartbeat {
+			g.kick(k.session)
+			return
+		}
+	}
+}
+
+func (g *Gate) openKcp(conf *Conf) {
+	log.Infoln("Kcp Gate start, listen ", conf.address)
+	listener, err := kcp.ListenWithOptions(conf.address, nil, 0, 0)
+	if err != nil {
+		panic("gate kcp open error:" + err.Error())
+	}
+	g.listener = listener
+	go func() {
+		defer listener.Close()
+		for {
+			sess, err := listener.AcceptKCP()
+			if err != nil {
+				return // listener closed (Shutdown) or otherwise unusable
+			}
+			session := g.nextSession()
+			backend := newKcpBackend(session, sess, g, conf)
+			if !g.addSession(session, backend) {
+				backend.Close()
+				continue
+			}
+			g.service.Notify(g.Source, cham.PTYPE_CLIENT, session, OnOpen, backend.PeerInfo())
+			go backend.serve(g)
+			go backend.monitorHeartbeat(g)
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package gate
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowBackend is a Backend whose Drain and Close each take drainDelay /
+// closeDelay to finish (or until ctx is done, for Drain) -- standing in
+// for a peer that is slow, or never, to ack a close frame.
+type slowBackend struct {
+	drainDelay time.Duration
+	closeDelay time.Duration
+	closed     chan struct{}
+}
+
+func newSlowBackend(drainDelay, closeDelay time.Duration) *slowBackend {
+	return &slowBackend{drainDelay: drainDelay, closeDelay: closeDelay, closed: make(chan struct{})}
+}
+
+func (s *slowBackend) Write(data []byte) error { return nil }
+func (s *slowBackend) PeerInfo() string        { return "" }
+
+func (s *slowBackend) Drain(ctx context.Context) {
+	select {
+	case <-time.After(s.drainDelay):
+	case <-ctx.Done():
+	}
+}
+
+func (s *slowBackend) Close() {
+	time.Sleep(s.closeDelay)
+	close(s.closed)
+}
+
+func TestGateShutdownRespectsDeadline(t *testing.T) {
+	g := &Gate{
+		rwmutex: new(sync.RWMutex),
+		sessions: map[uint32]Backend{
+			1: newSlowBackend(time.Hour, time.Hour), // never finishes within the deadline below
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := g.Shutdown(ctx)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Shutdown with a deadline-exceeding backend: got nil error, want ctx.Err()")
+	}
+	if elapsed > time.Second {
+		t.Fatalf("Shutdown blocked for %v past a 20ms deadline", elapsed)
+	}
+}
+
+func TestGateShutdownReturnsNilWhenDrainFinishesInTime(t *testing.T) {
+	fast := newSlowBackend(0, 0)
+	g := &Gate{
+		rwmutex: new(sync.RWMutex),
+		sessions: map[uint32]Backend{
+			1: fast,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := g.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with a well-behaved backend: got %v, want nil", err)
+	}
+	select {
+	case <-fast.closed:
+	default:
+		t.Fatal("Shutdown returned without closing the backend")
+	}
+}
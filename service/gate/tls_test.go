@@ -0,0 +1,103 @@
+package gate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pemEncode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func generateSelfSignedCert(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := tls.X509KeyPair(
+		pemEncode("CERTIFICATE", der),
+		pemEncode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+	)
+	if err != nil {
+		t.Fatalf("build keypair: %v", err)
+	}
+	return cert
+}
+
+func TestPeerSubject(t *testing.T) {
+	cert := generateSelfSignedCert(t, "client.example")
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse leaf: %v", err)
+	}
+
+	if got := peerSubject(nil); got != "" {
+		t.Fatalf("peerSubject(nil) = %q, want empty", got)
+	}
+	if got := peerSubject(&tls.ConnectionState{}); got != "" {
+		t.Fatalf("peerSubject(no certs) = %q, want empty", got)
+	}
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	if got, want := peerSubject(state), leaf.Subject.String(); got != want {
+		t.Fatalf("peerSubject() = %q, want %q", got, want)
+	}
+}
+
+// TestAcceptTcpDoesNotBlockOnStalledHandshake reproduces the scenario the
+// handshake-off-accept-goroutine fix (ab5f528) targets: a peer that never
+// completes its TLS handshake must not stop the Gate from admitting
+// other, well-behaved connections.
+func TestAcceptTcpDoesNotBlockOnStalledHandshake(t *testing.T) {
+	serverCert := generateSelfSignedCert(t, "gate.example")
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	g := &Gate{rwmutex: new(sync.RWMutex), sessions: make(map[uint32]Backend)}
+	conf := NewConf("", 0, "").WithTLS(tlsConf)
+
+	// First connection: the client side never sends a ClientHello, so
+	// the server's Handshake() call inside acceptTcp blocks.
+	stalledClient, stalledServer := net.Pipe()
+	defer stalledClient.Close()
+	go g.acceptTcp(tls.Server(stalledServer, tlsConf), conf)
+	time.Sleep(20 * time.Millisecond) // let that goroutine reach Handshake
+
+	// Second, independent plaintext connection must still be admitted
+	// promptly -- proving the stalled handshake above only ties up its
+	// own goroutine, not the Gate.
+	plainClient, plainServer := net.Pipe()
+	defer plainClient.Close()
+	go g.acceptTcp(plainServer, conf)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.rwmutex.RLock()
+		n := len(g.sessions)
+		g.rwmutex.RUnlock()
+		if n >= 1 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("second connection was not admitted promptly; a stalled handshake appears to have blocked it")
+}
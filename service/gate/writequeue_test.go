@@ -0,0 +1,81 @@
+package gate
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTcpBackendWriteDropsOnFullQueue(t *testing.T) {
+	g := &Gate{rwmutex: new(sync.RWMutex), sessions: make(map[uint32]Backend)}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	conf := NewConf("", 0, "").WithWriteQueueSize(1)
+	backend := newTcpBackend(1, serverConn, "", g, conf)
+	g.sessions[1] = backend
+	g.clinetnum = 1
+
+	// Nobody reads clientConn, so once writeLoop dequeues this frame it
+	// blocks on the actual network write, leaving the (size-1) outbound
+	// channel empty and ready to accept exactly one more frame.
+	if err := backend.Write([]byte("a")); err != nil {
+		t.Fatalf("first Write: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let writeLoop dequeue and block
+
+	if err := backend.Write([]byte("b")); err != nil {
+		t.Fatalf("second Write (fills the queue): %v", err)
+	}
+	if err := backend.Write([]byte("c")); err != errWriteQueueFull {
+		t.Fatalf("third Write (queue full): got %v, want errWriteQueueFull", err)
+	}
+
+	if got := g.Stats().DroppedFrames; got != 1 {
+		t.Fatalf("DroppedFrames = %d, want 1", got)
+	}
+
+	// The overflow also kicks the session, asynchronously.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		g.rwmutex.RLock()
+		_, ok := g.sessions[1]
+		g.rwmutex.RUnlock()
+		if !ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("session was not kicked after its write queue overflowed")
+}
+
+// TestTcpBackendCloseDoesNotHangOnStalledWrite is a regression test for
+// 0489825: Close must close the connection before waiting on writeLoop,
+// since without a WriteTimeout a stalled peer leaves writeLoop blocked
+// in a plain syscall write that never observes t.done.
+func TestTcpBackendCloseDoesNotHangOnStalledWrite(t *testing.T) {
+	g := &Gate{rwmutex: new(sync.RWMutex), sessions: make(map[uint32]Backend)}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	conf := NewConf("", 0, "") // no WithWriteTimeout
+	backend := newTcpBackend(1, serverConn, "", g, conf)
+
+	if err := backend.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // let writeLoop enter the blocking write
+
+	done := make(chan struct{})
+	go func() {
+		backend.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close blocked on a stalled write with no WriteTimeout set")
+	}
+}